@@ -0,0 +1,238 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package graceful tracks the file descriptors backing the TCP/Unix listeners used by the HTTP and TCP
+// server implementations so that a running teamserver can be hot-reloaded, via re-exec or socket
+// activation, without dropping in-flight Agent connections. The approach is modeled on the listener
+// hand-off used by Gitea's modules/graceful package and honors the systemd socket-activation
+// environment variable convention (LISTEN_FDS/LISTEN_PID).
+package graceful
+
+import (
+	// Standard
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	// 3rd Party
+	uuid "github.com/satori/go.uuid"
+)
+
+// listenFDsStart is the first file descriptor number systemd/the re-exec convention hands off, per the
+// LISTEN_FDS environment variable protocol (fd 0-2 are stdin/stdout/stderr)
+const listenFDsStart = 3
+
+// envListenFDs is the environment variable a parent process sets to tell its child how many inherited
+// listener file descriptors follow fd 3
+const envListenFDs = "LISTEN_FDS"
+
+// envListenPID is the environment variable a parent process sets to the child's PID so the child can
+// confirm the inherited file descriptors were meant for it
+const envListenPID = "LISTEN_PID"
+
+// defaultHammerTimeout is used when a Manager is created without an explicit call to SetHammerTimeout
+const defaultHammerTimeout = 30 * time.Second
+
+// scratchFDsStart is a high file descriptor number ReExec dup2's every tracked listener onto before
+// compacting them down into the final contiguous LISTEN_FDS block. It's chosen well above any fd this
+// process is expected to have open, so a listener can never land on a target slot another, not-yet-moved
+// listener's source fd still occupies
+const scratchFDsStart = 1024
+
+// Manager tracks the listening file descriptors owned by this process, keyed by the UUID of the
+// Listener that owns them, so they can be handed off across a restart instead of being closed and rebound
+type Manager struct {
+	mu            sync.Mutex
+	listeners     map[uuid.UUID]*os.File
+	hammerTimeout time.Duration
+}
+
+// NewManager is a factory that returns a Manager ready to track listener file descriptors
+func NewManager() *Manager {
+	return &Manager{
+		listeners:     make(map[uuid.UUID]*os.File),
+		hammerTimeout: defaultHammerTimeout,
+	}
+}
+
+// SetHammerTimeout sets the duration a graceful shutdown waits for in-flight Agent requests to
+// complete before the underlying connections are forcibly closed
+func (m *Manager) SetHammerTimeout(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hammerTimeout = d
+}
+
+// HammerTimeout returns the duration a graceful shutdown will wait for in-flight requests to finish
+func (m *Manager) HammerTimeout() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hammerTimeout
+}
+
+// Register takes ownership of the passed in net.Listener's underlying file descriptor so it can be
+// recovered across a graceful restart, keyed by the listener UUID it belongs to
+func (m *Manager) Register(id uuid.UUID, l net.Listener) error {
+	var f *os.File
+	var err error
+	switch t := l.(type) {
+	case *net.TCPListener:
+		f, err = t.File()
+	case *net.UnixListener:
+		f, err = t.File()
+	default:
+		return fmt.Errorf("pkg/graceful.Register(): unsupported listener type %T for listener %s", l, id)
+	}
+	if err != nil {
+		return fmt.Errorf("pkg/graceful.Register(): %s", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners[id] = f
+	return nil
+}
+
+// Unregister stops tracking the file descriptor associated with the provided listener UUID, closing the
+// dup'd *os.File Register created so the descriptor doesn't leak for the remaining life of the process
+func (m *Manager) Unregister(id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.listeners[id]; ok {
+		_ = f.Close()
+		delete(m.listeners, id)
+	}
+}
+
+// InheritedListeners inspects the LISTEN_FDS/LISTEN_PID environment variables, per the systemd
+// socket-activation convention, and returns a net.Listener for every inherited file descriptor. The
+// returned slice has no notion of which Listener config each entry belongs to; callers are expected to
+// match them by bind address
+func InheritedListeners() (ls []net.Listener, err error) {
+	count, err := listenFDCount()
+	if err != nil || count == 0 {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		f := os.NewFile(uintptr(listenFDsStart+i), fmt.Sprintf("listener-fd-%d", i))
+		l, lErr := net.FileListener(f)
+		if lErr != nil {
+			return nil, fmt.Errorf("pkg/graceful.InheritedListeners(): %s", lErr)
+		}
+		// The net package dup()s the fd internally, so the original can be closed
+		_ = f.Close()
+		ls = append(ls, l)
+	}
+	return
+}
+
+// listenFDCount returns the number of inherited file descriptors set by a parent process, or 0 if this
+// process was not started with socket activation or the environment variables do not target this PID
+func listenFDCount() (int, error) {
+	pidStr := os.Getenv(envListenPID)
+	if pidStr == "" {
+		return 0, nil
+	}
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return 0, fmt.Errorf("pkg/graceful.listenFDCount(): invalid %s value %q: %s", envListenPID, pidStr, err)
+	}
+	if pid != os.Getpid() {
+		return 0, nil
+	}
+	fdStr := os.Getenv(envListenFDs)
+	if fdStr == "" {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return 0, fmt.Errorf("pkg/graceful.listenFDCount(): invalid %s value %q: %s", envListenFDs, fdStr, err)
+	}
+	return count, nil
+}
+
+// ReExec replaces the current process image, in place, with a fresh copy of the same binary and
+// arguments, passing every tracked listener file descriptor via the LISTEN_FDS/LISTEN_PID environment
+// variables so the new process can pick them up through InheritedListeners instead of rebinding. Unlike
+// forking a child with exec.Command, syscall.Exec keeps the same PID, which is what makes LISTEN_PID
+// valid for the process that inherits the descriptors - there is no intermediate child whose PID would
+// need to be learned and threaded through before it can confirm the hand-off was meant for it
+func (m *Manager) ReExec() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("pkg/graceful.ReExec(): %s", err)
+	}
+
+	// Order is not guaranteed by a Go map, but that's fine: InheritedListeners() only hands back a slice
+	// of listeners and the caller re-matches them to Listener configs by bind address. Assigning targets
+	// in a single pass is unsafe: a target slot in the low, sequential listenFDsStart range can collide
+	// with another tracked listener's still-unprocessed source fd, silently clobbering it before its own
+	// turn comes up. So every source fd is first dup'd up into the scratchFDsStart range, where nothing
+	// still pending can collide with it, and only once all of them are out of the way are they compacted
+	// down into the final contiguous LISTEN_FDS-style block starting at listenFDsStart; dup2 clears
+	// FD_CLOEXEC on the new descriptor, so it survives the exec
+	scratch := make([]int, 0, len(m.listeners))
+	for _, f := range m.listeners {
+		sfd, dErr := dupAbove(int(f.Fd()), scratchFDsStart)
+		if dErr != nil {
+			return fmt.Errorf("pkg/graceful.ReExec(): %s", dErr)
+		}
+		scratch = append(scratch, sfd)
+	}
+
+	fds := make([]uintptr, 0, len(scratch))
+	for _, sfd := range scratch {
+		target := uintptr(listenFDsStart + len(fds))
+		if err = syscall.Dup2(sfd, int(target)); err != nil {
+			return fmt.Errorf("pkg/graceful.ReExec(): %s", err)
+		}
+		_ = syscall.Close(sfd)
+		fds = append(fds, target)
+	}
+
+	env := os.Environ()
+	env = append(env, fmt.Sprintf("%s=%d", envListenPID, os.Getpid()))
+	env = append(env, fmt.Sprintf("%s=%d", envListenFDs, len(fds)))
+
+	argv := append([]string{executable}, os.Args[1:]...)
+	if err = syscall.Exec(executable, argv, env); err != nil {
+		return fmt.Errorf("pkg/graceful.ReExec(): %s", err)
+	}
+	return nil
+}
+
+// Kill sends the passed in signal to this process. It is not a step after ReExec: a successful ReExec
+// replaces this process image and never returns to its caller
+func Kill(sig syscall.Signal) error {
+	return syscall.Kill(os.Getpid(), sig)
+}
+
+// dupAbove duplicates fd onto the lowest available descriptor number that is >= min via fcntl(F_DUPFD),
+// guaranteeing the result can't collide with any descriptor below min
+func dupAbove(fd, min int) (int, error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), uintptr(syscall.F_DUPFD), uintptr(min))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
@@ -0,0 +1,102 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package graceful
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListenFDCount(t *testing.T) {
+	t.Run("no environment variables set", func(t *testing.T) {
+		t.Setenv(envListenPID, "")
+		t.Setenv(envListenFDs, "")
+		count, err := listenFDCount()
+		if err != nil {
+			t.Fatalf("listenFDCount() returned an unexpected error: %s", err)
+		}
+		if count != 0 {
+			t.Errorf("listenFDCount() = %d, want 0", count)
+		}
+	})
+
+	t.Run("pid does not match this process", func(t *testing.T) {
+		t.Setenv(envListenPID, strconv.Itoa(os.Getpid()+1))
+		t.Setenv(envListenFDs, "3")
+		count, err := listenFDCount()
+		if err != nil {
+			t.Fatalf("listenFDCount() returned an unexpected error: %s", err)
+		}
+		if count != 0 {
+			t.Errorf("listenFDCount() = %d, want 0", count)
+		}
+	})
+
+	t.Run("pid matches and fd count is set", func(t *testing.T) {
+		t.Setenv(envListenPID, strconv.Itoa(os.Getpid()))
+		t.Setenv(envListenFDs, "3")
+		count, err := listenFDCount()
+		if err != nil {
+			t.Fatalf("listenFDCount() returned an unexpected error: %s", err)
+		}
+		if count != 3 {
+			t.Errorf("listenFDCount() = %d, want 3", count)
+		}
+	})
+
+	t.Run("pid matches but fd count is missing", func(t *testing.T) {
+		t.Setenv(envListenPID, strconv.Itoa(os.Getpid()))
+		t.Setenv(envListenFDs, "")
+		count, err := listenFDCount()
+		if err != nil {
+			t.Fatalf("listenFDCount() returned an unexpected error: %s", err)
+		}
+		if count != 0 {
+			t.Errorf("listenFDCount() = %d, want 0", count)
+		}
+	})
+
+	t.Run("invalid pid", func(t *testing.T) {
+		t.Setenv(envListenPID, "not-a-pid")
+		t.Setenv(envListenFDs, "3")
+		if _, err := listenFDCount(); err == nil {
+			t.Error("listenFDCount() did not return an error for an invalid LISTEN_PID")
+		}
+	})
+
+	t.Run("invalid fd count", func(t *testing.T) {
+		t.Setenv(envListenPID, strconv.Itoa(os.Getpid()))
+		t.Setenv(envListenFDs, "not-a-number")
+		if _, err := listenFDCount(); err == nil {
+			t.Error("listenFDCount() did not return an error for an invalid LISTEN_FDS")
+		}
+	})
+}
+
+func TestManagerHammerTimeout(t *testing.T) {
+	m := NewManager()
+	if m.HammerTimeout() != defaultHammerTimeout {
+		t.Errorf("HammerTimeout() = %s, want default %s", m.HammerTimeout(), defaultHammerTimeout)
+	}
+	m.SetHammerTimeout(5 * time.Second)
+	if m.HammerTimeout() != 5*time.Second {
+		t.Errorf("HammerTimeout() = %s, want %s", m.HammerTimeout(), 5*time.Second)
+	}
+}
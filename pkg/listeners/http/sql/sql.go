@@ -0,0 +1,211 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package sql is a database/sql backed implementation of the http.Repository interface, selectable for
+// any registered driver that accepts "?" query placeholders (e.g. SQLite; drivers that only accept
+// numbered placeholders such as $1, like the Postgres drivers, are not supported), that persists every HTTP Listener's full
+// configuration - including its PSK and JWT key - so it survives a teamserver restart. The persistence
+// skeleton itself lives in pkg/listeners/internal/sqlstore, shared with the TCP backend; this package
+// additionally keeps an in-memory index of the live, already-bound http.Listener for every record Add
+// has seen this process run, since unlike a TCP Listener an HTTP Listener owns an infrastructure-layer
+// Server that must not be silently reconstructed from scratch on every lookup
+package sql
+
+import (
+	// Standard
+	"fmt"
+	"sync"
+
+	// 3rd Party
+	uuid "github.com/satori/go.uuid"
+
+	// Merlin
+	"github.com/Ne0nd0g/merlin/pkg/listeners"
+	"github.com/Ne0nd0g/merlin/pkg/listeners/http"
+	"github.com/Ne0nd0g/merlin/pkg/listeners/internal/sqlstore"
+	httpServer "github.com/Ne0nd0g/merlin/pkg/servers/http"
+)
+
+// tableName is the table this backend persists HTTP Listeners to
+const tableName = "http_listeners"
+
+// Repository is a database/sql backed implementation of the http.Repository and
+// listeners.PersistentRepository interfaces
+type Repository struct {
+	store *sqlstore.Store
+	mu    sync.RWMutex
+	// live indexes the in-process http.Listener Add was given for an ID, so later lookups return the
+	// Listener whose Server is actually running instead of a disk reconstruction that was never started
+	live map[uuid.UUID]http.Listener
+}
+
+// NewRepository opens a database/sql connection using driver and dataSourceName and returns a
+// Repository backed by it
+func NewRepository(driver, dataSourceName string) (*Repository, error) {
+	store, err := sqlstore.Open(driver, dataSourceName, tableName, "http")
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/http/sql.NewRepository(): %s", err)
+	}
+	return &Repository{store: store, live: make(map[uuid.UUID]http.Listener)}, nil
+}
+
+// Migrate brings the table's schema version up to date; no migrations are defined yet beyond table
+// creation, which NewRepository already performs
+func (r *Repository) Migrate() error {
+	return r.store.Migrate()
+}
+
+// Persist write-throughs an HTTP Listener's full configuration - including its PSK and JWT key, which
+// live in the options map - keyed by its UUID
+func (r *Repository) Persist(id uuid.UUID, name, protocol string, options map[string]string, autoStart bool) error {
+	return r.store.Persist(id, name, protocol, options, autoStart)
+}
+
+// Forget removes an HTTP Listener's persisted configuration
+func (r *Repository) Forget(id uuid.UUID) error {
+	return r.store.Forget(id)
+}
+
+// Hydrate returns every HTTP Listener configuration currently in the store
+func (r *Repository) Hydrate() ([]listeners.PersistedListener, error) {
+	return r.store.Hydrate()
+}
+
+// httpServerFromOptions reconstructs the infrastructure layer Server a persisted HTTP Listener needs to
+// be re-created against. It's only used as a cold-start fallback in ListenerByID/ListenerByName/Listeners
+// when no live Listener has been cached for a record's ID yet
+func httpServerFromOptions(options map[string]string) (*httpServer.Server, error) {
+	hServer, err := httpServer.New(options)
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/http/sql.httpServerFromOptions(): %s", err)
+	}
+	return &hServer, nil
+}
+
+// Add stores a newly created HTTP Listener in the repository and caches it as the live, in-process
+// instance for its ID, so ListenerByID/ListenerByName/Listeners hand back the Listener whose Server is
+// actually running instead of reconstructing a fresh, never-started one from disk. If a record for this
+// ID already exists - as it does when hydrate() re-adds a Listener it just read off disk - the persisted
+// Options/AutoStart are left alone
+func (r *Repository) Add(listener http.Listener) error {
+	r.mu.Lock()
+	r.live[listener.ID()] = listener
+	r.mu.Unlock()
+	return r.store.AddIfAbsent(listener.ID(), listener.Name())
+}
+
+// liveByID returns the cached, in-process Listener for id, if Add has been called for it this run
+func (r *Repository) liveByID(id uuid.UUID) (listener http.Listener, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	listener, ok = r.live[id]
+	return
+}
+
+// liveByName returns the cached, in-process Listener whose name matches, if any
+func (r *Repository) liveByName(name string) (listener http.Listener, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, l := range r.live {
+		if l.Name() == name {
+			return l, true
+		}
+	}
+	return
+}
+
+// ListenerByID returns the HTTP Listener that matches the input UUID, preferring the live, already-bound
+// instance Add cached over reconstructing one from disk
+func (r *Repository) ListenerByID(id uuid.UUID) (listener http.Listener, err error) {
+	if live, ok := r.liveByID(id); ok {
+		return live, nil
+	}
+	records, err := r.store.Hydrate()
+	if err != nil {
+		return listener, err
+	}
+	for _, rec := range records {
+		if rec.ID == id {
+			hServer, sErr := httpServerFromOptions(rec.Options)
+			if sErr != nil {
+				return listener, sErr
+			}
+			return http.NewHTTPListener(hServer, rec.Options)
+		}
+	}
+	return listener, fmt.Errorf("pkg/listeners/http/sql.ListenerByID(): could not find listener %s", id)
+}
+
+// ListenerByName returns the first HTTP Listener that matches the input name, preferring a live instance
+func (r *Repository) ListenerByName(name string) (listener http.Listener, err error) {
+	if live, ok := r.liveByName(name); ok {
+		return live, nil
+	}
+	records, err := r.store.Hydrate()
+	if err != nil {
+		return listener, err
+	}
+	for _, rec := range records {
+		if rec.Name == name {
+			hServer, sErr := httpServerFromOptions(rec.Options)
+			if sErr != nil {
+				return listener, sErr
+			}
+			return http.NewHTTPListener(hServer, rec.Options)
+		}
+	}
+	return listener, fmt.Errorf("pkg/listeners/http/sql.ListenerByName(): could not find listener %s", name)
+}
+
+// Listeners returns every HTTP Listener currently in the store, preferring each one's live instance over
+// a disk reconstruction whenever one is cached
+func (r *Repository) Listeners() (out []http.Listener) {
+	records, err := r.store.Hydrate()
+	if err != nil {
+		return nil
+	}
+	for _, rec := range records {
+		if live, ok := r.liveByID(rec.ID); ok {
+			out = append(out, live)
+			continue
+		}
+		hServer, err := httpServerFromOptions(rec.Options)
+		if err != nil {
+			continue
+		}
+		listener, err := http.NewHTTPListener(hServer, rec.Options)
+		if err != nil {
+			continue
+		}
+		out = append(out, listener)
+	}
+	return
+}
+
+// RemoveByID deletes the HTTP Listener that matches the input UUID, forgetting both its persisted
+// configuration and its cached live instance
+func (r *Repository) RemoveByID(id uuid.UUID) error {
+	r.mu.Lock()
+	delete(r.live, id)
+	r.mu.Unlock()
+	return r.store.Forget(id)
+}
+
+// UpdateOptions replaces an HTTP Listener's configurable options map with the one provided
+func (r *Repository) UpdateOptions(id uuid.UUID, options map[string]string) error {
+	return r.store.UpdateOptions(id, options)
+}
@@ -0,0 +1,178 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package boltstore is the BoltDB-backed persistence skeleton shared by every
+// listeners.PersistentRepository implementation (TCP and HTTP, under pkg/listeners/tcp/boltdb and
+// pkg/listeners/http/boltdb): both persist the exact same {ID, Name, Options, AutoStart} record shape and
+// differ only in which in-memory Listener type a record gets reconstructed into, so that
+// protocol-specific reconstruction is all that's left in the two callers
+package boltstore
+
+import (
+	// Standard
+	"encoding/json"
+	"fmt"
+
+	// 3rd Party
+	bolt "go.etcd.io/bbolt"
+	uuid "github.com/satori/go.uuid"
+
+	// Merlin
+	"github.com/Ne0nd0g/merlin/pkg/listeners"
+)
+
+// schemaVersion is incremented whenever the on-disk record layout changes so Migrate knows when to
+// rewrite existing records
+const schemaVersion = 1
+
+var listenersBucket = []byte("listeners")
+var metaBucket = []byte("meta")
+var schemaKey = []byte("schema_version")
+
+// record is the on-disk representation of a persisted Listener, common to every protocol
+type record struct {
+	ID        uuid.UUID
+	Name      string
+	Options   map[string]string
+	AutoStart bool
+}
+
+// Store implements the Migrate/Persist/Forget/Hydrate/UpdateOptions skeleton every BoltDB-backed
+// listeners.PersistentRepository needs
+type Store struct {
+	db              *bolt.DB
+	defaultProtocol string
+}
+
+// Open opens (creating if necessary) a BoltDB file at path and returns a Store backed by it.
+// defaultProtocol is reported for any record whose Options map has no "Protocol" key of its own (e.g. TCP,
+// which doesn't carry one)
+func Open(path, defaultProtocol string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/internal/boltstore.Open(): %s", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err = tx.CreateBucketIfNotExists(listenersBucket); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/internal/boltstore.Open(): %s", err)
+	}
+	return &Store{db: db, defaultProtocol: defaultProtocol}, nil
+}
+
+// Migrate brings the bucket's schema version up to date by stamping the current schemaVersion; no record
+// rewrites are defined yet, so existing records are left as they are
+func (s *Store) Migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		current := meta.Get(schemaKey)
+		if len(current) > 0 && string(current) == fmt.Sprintf("%d", schemaVersion) {
+			return nil
+		}
+		// No prior migrations are defined yet; simply stamp the current version
+		return meta.Put(schemaKey, []byte(fmt.Sprintf("%d", schemaVersion)))
+	})
+}
+
+// protocolFor reports the Protocol a record with the given Options should be hydrated as: the value of
+// its own "Protocol" option if it has one, falling back to the Store's defaultProtocol otherwise
+func (s *Store) protocolFor(options map[string]string) string {
+	if p := options["Protocol"]; p != "" {
+		return p
+	}
+	return s.defaultProtocol
+}
+
+// Persist write-throughs a Listener's full configuration, keyed by its UUID. The protocol argument is
+// ignored - it's derived from options (or defaultProtocol) on read instead, matching what Hydrate reports
+func (s *Store) Persist(id uuid.UUID, name, _ string, options map[string]string, autoStart bool) error {
+	rec := record{ID: id, Name: name, Options: options, AutoStart: autoStart}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("pkg/listeners/internal/boltstore.Persist(): %s", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(listenersBucket).Put(id.Bytes(), data)
+	})
+}
+
+// Forget removes a Listener's persisted configuration
+func (s *Store) Forget(id uuid.UUID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(listenersBucket).Delete(id.Bytes())
+	})
+}
+
+// Hydrate returns every Listener configuration currently in the store
+func (s *Store) Hydrate() (out []listeners.PersistedListener, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(listenersBucket).ForEach(func(_, v []byte) error {
+			var rec record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			out = append(out, listeners.PersistedListener{
+				ID:        rec.ID,
+				Name:      rec.Name,
+				Protocol:  s.protocolFor(rec.Options),
+				Options:   rec.Options,
+				AutoStart: rec.AutoStart,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/internal/boltstore.Hydrate(): %s", err)
+	}
+	return
+}
+
+// AddIfAbsent persists a bare record for id/name the first time it's seen, and is a no-op if a record
+// already exists - as it does when hydrate() re-adds a Listener it just read off disk - so it doesn't
+// clobber the persisted Options/AutoStart with the zero values a brand new in-memory Listener carries
+func (s *Store) AddIfAbsent(id uuid.UUID, name string) error {
+	records, err := s.Hydrate()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if rec.ID == id {
+			return nil
+		}
+	}
+	return s.Persist(id, name, "", nil, false)
+}
+
+// UpdateOptions replaces a Listener's configurable options map with the one provided, preserving its
+// persisted Name and AutoStart flag
+func (s *Store) UpdateOptions(id uuid.UUID, options map[string]string) error {
+	records, err := s.Hydrate()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if rec.ID == id {
+			return s.Persist(id, rec.Name, "", options, rec.AutoStart)
+		}
+	}
+	return fmt.Errorf("pkg/listeners/internal/boltstore.UpdateOptions(): could not find listener %s", id)
+}
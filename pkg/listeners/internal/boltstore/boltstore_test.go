@@ -0,0 +1,158 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package boltstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func openTestStore(t *testing.T, defaultProtocol string) *Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "listeners.db")
+	store, err := Open(path, defaultProtocol)
+	if err != nil {
+		t.Fatalf("Open() returned an unexpected error: %s", err)
+	}
+	return store
+}
+
+func newTestUUID(t *testing.T) uuid.UUID {
+	t.Helper()
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatalf("uuid.NewV4() returned an unexpected error: %s", err)
+	}
+	return id
+}
+
+func TestStorePersistHydrate(t *testing.T) {
+	store := openTestStore(t, "tcp")
+	id := newTestUUID(t)
+	options := map[string]string{"Interface": "0.0.0.0", "Port": "4444"}
+
+	if err := store.Persist(id, "my-listener", "", options, true); err != nil {
+		t.Fatalf("Persist() returned an unexpected error: %s", err)
+	}
+
+	records, err := store.Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate() returned an unexpected error: %s", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Hydrate() returned %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.ID != id || rec.Name != "my-listener" || rec.Protocol != "tcp" || !rec.AutoStart {
+		t.Errorf("Hydrate() = %+v, did not round-trip the persisted record", rec)
+	}
+	if rec.Options["Port"] != "4444" {
+		t.Errorf("Hydrate() options = %+v, want Port=4444", rec.Options)
+	}
+}
+
+func TestStoreProtocolFromOptions(t *testing.T) {
+	store := openTestStore(t, "http")
+	id := newTestUUID(t)
+	options := map[string]string{"Protocol": "https"}
+
+	if err := store.Persist(id, "admin-api", "", options, false); err != nil {
+		t.Fatalf("Persist() returned an unexpected error: %s", err)
+	}
+
+	records, err := store.Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate() returned an unexpected error: %s", err)
+	}
+	if records[0].Protocol != "https" {
+		t.Errorf("Hydrate() protocol = %q, want %q (derived from options, not the store default)", records[0].Protocol, "https")
+	}
+}
+
+func TestStoreForget(t *testing.T) {
+	store := openTestStore(t, "tcp")
+	id := newTestUUID(t)
+	if err := store.Persist(id, "to-delete", "", nil, false); err != nil {
+		t.Fatalf("Persist() returned an unexpected error: %s", err)
+	}
+	if err := store.Forget(id); err != nil {
+		t.Fatalf("Forget() returned an unexpected error: %s", err)
+	}
+	records, err := store.Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate() returned an unexpected error: %s", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Hydrate() returned %d records after Forget, want 0", len(records))
+	}
+}
+
+func TestStoreAddIfAbsent(t *testing.T) {
+	store := openTestStore(t, "tcp")
+	id := newTestUUID(t)
+
+	// First call persists a bare record
+	if err := store.AddIfAbsent(id, "listener-a"); err != nil {
+		t.Fatalf("AddIfAbsent() returned an unexpected error: %s", err)
+	}
+	if err := store.Persist(id, "listener-a", "", map[string]string{"Port": "1234"}, true); err != nil {
+		t.Fatalf("Persist() returned an unexpected error: %s", err)
+	}
+
+	// A second call for the same ID must not clobber the Options/AutoStart already persisted
+	if err := store.AddIfAbsent(id, "listener-a"); err != nil {
+		t.Fatalf("AddIfAbsent() returned an unexpected error: %s", err)
+	}
+
+	records, err := store.Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate() returned an unexpected error: %s", err)
+	}
+	if len(records) != 1 || records[0].Options["Port"] != "1234" || !records[0].AutoStart {
+		t.Errorf("AddIfAbsent() clobbered the already-persisted record: %+v", records)
+	}
+}
+
+func TestStoreUpdateOptions(t *testing.T) {
+	store := openTestStore(t, "tcp")
+	id := newTestUUID(t)
+	if err := store.Persist(id, "listener-a", "", map[string]string{"Port": "1234"}, true); err != nil {
+		t.Fatalf("Persist() returned an unexpected error: %s", err)
+	}
+
+	if err := store.UpdateOptions(id, map[string]string{"Port": "5678"}); err != nil {
+		t.Fatalf("UpdateOptions() returned an unexpected error: %s", err)
+	}
+
+	records, err := store.Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate() returned an unexpected error: %s", err)
+	}
+	if records[0].Options["Port"] != "5678" {
+		t.Errorf("UpdateOptions() options = %+v, want Port=5678", records[0].Options)
+	}
+	if records[0].Name != "listener-a" || !records[0].AutoStart {
+		t.Errorf("UpdateOptions() did not preserve Name/AutoStart: %+v", records[0])
+	}
+
+	if err := store.UpdateOptions(newTestUUID(t), nil); err == nil {
+		t.Error("UpdateOptions() did not return an error for an unknown listener ID")
+	}
+}
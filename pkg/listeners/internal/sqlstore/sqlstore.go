@@ -0,0 +1,178 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package sqlstore is the database/sql-backed persistence skeleton shared by every
+// listeners.PersistentRepository implementation (TCP and HTTP, under pkg/listeners/tcp/sql and
+// pkg/listeners/http/sql): both persist the exact same {ID, Name, Options, AutoStart} record shape into a
+// single table and differ only in the table name and which in-memory Listener type a record gets
+// reconstructed into, so that protocol-specific reconstruction is all that's left in the two callers
+package sqlstore
+
+import (
+	// Standard
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	// 3rd Party
+	uuid "github.com/satori/go.uuid"
+
+	// Merlin
+	"github.com/Ne0nd0g/merlin/pkg/listeners"
+)
+
+// schemaVersion is incremented whenever the table layout changes so Migrate knows when to alter it
+const schemaVersion = 1
+
+const createTableStmt = `
+CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	options TEXT NOT NULL,
+	auto_start BOOLEAN NOT NULL,
+	schema_version INTEGER NOT NULL
+)`
+
+// Store implements the Migrate/Persist/Forget/Hydrate/UpdateOptions skeleton every database/sql-backed
+// listeners.PersistentRepository needs
+type Store struct {
+	db              *sql.DB
+	table           string
+	defaultProtocol string
+}
+
+// Open opens a database/sql connection using driver and dataSourceName, creating table if it doesn't
+// already exist, and returns a Store backed by it. defaultProtocol is reported for any record whose
+// Options map has no "Protocol" key of its own (e.g. TCP, which doesn't carry one). table is interpolated
+// directly into the CREATE TABLE/INSERT/SELECT/DELETE statements - it's always one of the fixed,
+// hardcoded table names the two callers pass in, never attacker-influenced data
+func Open(driver, dataSourceName, table, defaultProtocol string) (*Store, error) {
+	db, err := sql.Open(driver, dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/internal/sqlstore.Open(): %s", err)
+	}
+	if _, err = db.Exec(fmt.Sprintf(createTableStmt, table)); err != nil {
+		return nil, fmt.Errorf("pkg/listeners/internal/sqlstore.Open(): %s", err)
+	}
+	return &Store{db: db, table: table, defaultProtocol: defaultProtocol}, nil
+}
+
+// Migrate brings the table's schema version up to date; no migrations are defined yet beyond table
+// creation, which Open already performs
+func (s *Store) Migrate() error {
+	return nil
+}
+
+// protocolFor reports the Protocol a record with the given Options should be hydrated as: the value of
+// its own "Protocol" option if it has one, falling back to the Store's defaultProtocol otherwise
+func (s *Store) protocolFor(options map[string]string) string {
+	if p := options["Protocol"]; p != "" {
+		return p
+	}
+	return s.defaultProtocol
+}
+
+// Persist write-throughs a Listener's full configuration, keyed by its UUID. The protocol argument is
+// ignored - it's derived from options (or defaultProtocol) on read instead, matching what Hydrate reports
+func (s *Store) Persist(id uuid.UUID, name, _ string, options map[string]string, autoStart bool) error {
+	data, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("pkg/listeners/internal/sqlstore.Persist(): %s", err)
+	}
+	_, err = s.db.Exec(fmt.Sprintf(`
+		INSERT INTO %s (id, name, options, auto_start, schema_version) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET name=excluded.name, options=excluded.options, auto_start=excluded.auto_start, schema_version=excluded.schema_version`, s.table),
+		id.String(), name, string(data), autoStart, schemaVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("pkg/listeners/internal/sqlstore.Persist(): %s", err)
+	}
+	return nil
+}
+
+// Forget removes a Listener's persisted configuration
+func (s *Store) Forget(id uuid.UUID) error {
+	_, err := s.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, s.table), id.String())
+	if err != nil {
+		return fmt.Errorf("pkg/listeners/internal/sqlstore.Forget(): %s", err)
+	}
+	return nil
+}
+
+// Hydrate returns every Listener configuration currently in the store
+func (s *Store) Hydrate() (out []listeners.PersistedListener, err error) {
+	rows, err := s.db.Query(fmt.Sprintf(`SELECT id, name, options, auto_start FROM %s`, s.table))
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/internal/sqlstore.Hydrate(): %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idStr, name, optionsJSON string
+		var autoStart bool
+		if err = rows.Scan(&idStr, &name, &optionsJSON, &autoStart); err != nil {
+			return nil, fmt.Errorf("pkg/listeners/internal/sqlstore.Hydrate(): %s", err)
+		}
+		id, err := uuid.FromString(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("pkg/listeners/internal/sqlstore.Hydrate(): %s", err)
+		}
+		var options map[string]string
+		if err = json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+			return nil, fmt.Errorf("pkg/listeners/internal/sqlstore.Hydrate(): %s", err)
+		}
+		out = append(out, listeners.PersistedListener{
+			ID:        id,
+			Name:      name,
+			Protocol:  s.protocolFor(options),
+			Options:   options,
+			AutoStart: autoStart,
+		})
+	}
+	return out, rows.Err()
+}
+
+// AddIfAbsent persists a bare record for id/name the first time it's seen, and is a no-op if a record
+// already exists - as it does when hydrate() re-adds a Listener it just read off disk - so it doesn't
+// clobber the persisted Options/AutoStart with the zero values a brand new in-memory Listener carries
+func (s *Store) AddIfAbsent(id uuid.UUID, name string) error {
+	records, err := s.Hydrate()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if rec.ID == id {
+			return nil
+		}
+	}
+	return s.Persist(id, name, "", nil, false)
+}
+
+// UpdateOptions replaces a Listener's configurable options map with the one provided, preserving its
+// persisted Name and AutoStart flag
+func (s *Store) UpdateOptions(id uuid.UUID, options map[string]string) error {
+	records, err := s.Hydrate()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if rec.ID == id {
+			return s.Persist(id, rec.Name, "", options, rec.AutoStart)
+		}
+	}
+	return fmt.Errorf("pkg/listeners/internal/sqlstore.UpdateOptions(): could not find listener %s", id)
+}
@@ -0,0 +1,45 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package listeners
+
+import uuid "github.com/satori/go.uuid"
+
+// PersistedListener is the durable record a PersistentRepository hands back on Hydrate: everything
+// needed to reconstruct a Listener exactly as it was configured before the process exited
+type PersistedListener struct {
+	ID        uuid.UUID
+	Name      string
+	Protocol  string
+	Options   map[string]string
+	AutoStart bool
+}
+
+// PersistentRepository is implemented by Repository backends - currently the BoltDB and database/sql
+// implementations under pkg/listeners/http and pkg/listeners/tcp - that durably store a Listener's full
+// configuration instead of holding it only in memory. Callers type-assert for it so in-memory
+// repositories, which don't implement it, are unaffected
+type PersistentRepository interface {
+	// Migrate brings the backing store's schema up to the version this build expects
+	Migrate() error
+	// Persist write-throughs a Listener's full configuration, keyed by its UUID
+	Persist(id uuid.UUID, name, protocol string, options map[string]string, autoStart bool) error
+	// Forget removes a Listener's persisted configuration
+	Forget(id uuid.UUID) error
+	// Hydrate returns every Listener configuration currently in the store
+	Hydrate() ([]PersistedListener, error)
+}
@@ -0,0 +1,132 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package boltdb is a BoltDB backed implementation of the tcp.Repository interface that persists every
+// TCP Listener's full configuration to disk so it survives a teamserver restart. The persistence
+// skeleton itself lives in pkg/listeners/internal/boltstore, shared with the HTTP backend; this package
+// only adds the TCP-specific reconstruction of a stored record back into a tcp.Listener
+package boltdb
+
+import (
+	// Standard
+	"fmt"
+
+	// 3rd Party
+	uuid "github.com/satori/go.uuid"
+
+	// Merlin
+	"github.com/Ne0nd0g/merlin/pkg/listeners"
+	"github.com/Ne0nd0g/merlin/pkg/listeners/internal/boltstore"
+	"github.com/Ne0nd0g/merlin/pkg/listeners/tcp"
+)
+
+// Repository is a BoltDB backed implementation of the tcp.Repository and listeners.PersistentRepository
+// interfaces
+type Repository struct {
+	store *boltstore.Store
+}
+
+// NewRepository opens (creating if necessary) a BoltDB file at path and returns a Repository backed by it
+func NewRepository(path string) (*Repository, error) {
+	store, err := boltstore.Open(path, "tcp")
+	if err != nil {
+		return nil, fmt.Errorf("pkg/listeners/tcp/boltdb.NewRepository(): %s", err)
+	}
+	return &Repository{store: store}, nil
+}
+
+// Migrate brings the bucket's schema version up to date by stamping the current schema version; existing
+// records are not rewritten
+func (r *Repository) Migrate() error {
+	return r.store.Migrate()
+}
+
+// Persist write-throughs a TCP Listener's full configuration, keyed by its UUID
+func (r *Repository) Persist(id uuid.UUID, name, protocol string, options map[string]string, autoStart bool) error {
+	return r.store.Persist(id, name, protocol, options, autoStart)
+}
+
+// Forget removes a TCP Listener's persisted configuration
+func (r *Repository) Forget(id uuid.UUID) error {
+	return r.store.Forget(id)
+}
+
+// Hydrate returns every TCP Listener configuration currently in the store
+func (r *Repository) Hydrate() ([]listeners.PersistedListener, error) {
+	return r.store.Hydrate()
+}
+
+// Add stores a newly created TCP Listener in the repository. If a record for this ID already exists -
+// as it does when hydrate() re-adds a Listener it just read off disk - Add is a no-op so it doesn't
+// clobber the persisted Options/AutoStart with the zero values a brand new in-memory Listener carries
+func (r *Repository) Add(listener tcp.Listener) error {
+	return r.store.AddIfAbsent(listener.ID(), listener.Name())
+}
+
+// ListenerByID returns the TCP Listener that matches the input UUID
+func (r *Repository) ListenerByID(id uuid.UUID) (listener tcp.Listener, err error) {
+	records, err := r.store.Hydrate()
+	if err != nil {
+		return listener, err
+	}
+	for _, rec := range records {
+		if rec.ID == id {
+			return tcp.NewTCPListener(rec.Options)
+		}
+	}
+	return listener, fmt.Errorf("pkg/listeners/tcp/boltdb.ListenerByID(): could not find listener %s", id)
+}
+
+// ListenerByName returns the first TCP Listener that matches the input name
+func (r *Repository) ListenerByName(name string) (listener tcp.Listener, err error) {
+	records, err := r.store.Hydrate()
+	if err != nil {
+		return listener, err
+	}
+	for _, rec := range records {
+		if rec.Name == name {
+			return tcp.NewTCPListener(rec.Options)
+		}
+	}
+	return listener, fmt.Errorf("pkg/listeners/tcp/boltdb.ListenerByName(): could not find listener %s", name)
+}
+
+// Listeners returns every TCP Listener currently in the store
+func (r *Repository) Listeners() (out []tcp.Listener) {
+	records, err := r.store.Hydrate()
+	if err != nil {
+		return nil
+	}
+	for _, rec := range records {
+		listener, err := tcp.NewTCPListener(rec.Options)
+		if err != nil {
+			continue
+		}
+		out = append(out, listener)
+	}
+	return
+}
+
+// RemoveByID deletes the TCP Listener that matches the input UUID
+func (r *Repository) RemoveByID(id uuid.UUID) error {
+	return r.store.Forget(id)
+}
+
+// UpdateOptions replaces a TCP Listener's configurable options map with the one provided
+func (r *Repository) UpdateOptions(id uuid.UUID, options map[string]string) error {
+	return r.store.UpdateOptions(id, options)
+}
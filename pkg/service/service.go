@@ -0,0 +1,78 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package service defines the Endpoint/Service split that lets more than one handler - e.g. an
+// agent-facing listener, an operator REST API, and a Prometheus metrics exporter - share a single
+// bind address. The split is modeled on Blocky's service package: a Service only knows what
+// Endpoint(s) it wants to be reachable on, and ListenerService is responsible for grouping the
+// Services that resolve to the same Endpoint and starting exactly one underlying transport server
+// per Endpoint.
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// Endpoint identifies a bind address and the protocol spoken on it. Two Services that report the same
+// Endpoint are candidates to be merged onto a single listening socket
+type Endpoint struct {
+	Protocol string
+	Address  string
+}
+
+// String returns the Endpoint in "protocol://address" form, used as a human-readable identifier in
+// error messages and logs
+func (e Endpoint) String() string {
+	return fmt.Sprintf("%s://%s", e.Protocol, e.Address)
+}
+
+// Service is anything that wants to be reachable on one or more Endpoints - an Agent handler, an
+// operator-facing admin API, or a metrics exporter are all Services
+type Service interface {
+	// Name returns a unique, human-readable identifier for the Service, used in logging and error
+	// messages when two Services conflict over the same Endpoint
+	Name() string
+	// Endpoints returns every Endpoint this Service wants to be reachable on
+	Endpoints() []Endpoint
+}
+
+// Merger is implemented by Services that know how to combine themselves with another Service bound to
+// the same Endpoint, e.g. two HTTP-family Services mounting their routes at distinct path prefixes on a
+// shared http.ServeMux. Merge returns a new Service representing the combination; it does not mutate
+// either receiver
+type Merger interface {
+	Service
+	Merge(other Service) (Service, error)
+}
+
+// HandlerProvider is implemented by HTTP-family Services that expose the http.Handler to mount on the
+// transport server for their Endpoint. The result of merging every Service registered against an
+// Endpoint must implement this so ListenerService.Start has something to install on the running server
+type HandlerProvider interface {
+	Service
+	Handler() http.Handler
+}
+
+// TLSTerminator is implemented by Services that terminate TLS themselves, letting two Services sharing
+// an Endpoint be compared so they can't be silently combined with incompatible certificates or minimum
+// versions
+type TLSTerminator interface {
+	Service
+	TLS() *tls.Config
+}
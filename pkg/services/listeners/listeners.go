@@ -20,19 +20,30 @@ package listeners
 
 import (
 	// Standard
+	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"sort"
 	"strings"
+	"time"
 
 	// 3rd Party
 	uuid "github.com/satori/go.uuid"
 
 	// Merlin
+	"github.com/Ne0nd0g/merlin/pkg/graceful"
 	"github.com/Ne0nd0g/merlin/pkg/listeners"
 	"github.com/Ne0nd0g/merlin/pkg/listeners/http"
+	httpBolt "github.com/Ne0nd0g/merlin/pkg/listeners/http/boltdb"
 	httpMemory "github.com/Ne0nd0g/merlin/pkg/listeners/http/memory"
+	httpSQL "github.com/Ne0nd0g/merlin/pkg/listeners/http/sql"
 	"github.com/Ne0nd0g/merlin/pkg/listeners/tcp"
+	tcpBolt "github.com/Ne0nd0g/merlin/pkg/listeners/tcp/boltdb"
 	tcpMemory "github.com/Ne0nd0g/merlin/pkg/listeners/tcp/memory"
+	tcpSQL "github.com/Ne0nd0g/merlin/pkg/listeners/tcp/sql"
+	"github.com/Ne0nd0g/merlin/pkg/service"
 	"github.com/Ne0nd0g/merlin/pkg/servers"
 	httpServer "github.com/Ne0nd0g/merlin/pkg/servers/http"
 	httpServerRepo "github.com/Ne0nd0g/merlin/pkg/servers/http/memory"
@@ -43,39 +54,358 @@ type ListenerService struct {
 	tcpRepo        tcp.Repository
 	httpRepo       http.Repository
 	httpServerRepo httpServer.Repository
+	graceful       *graceful.Manager
+	// inherited holds listeners handed off by a prior process via socket activation, matched to their
+	// owning HTTP Listener by bind address during hydrate; any left unmatched are closed when hydrate ends
+	inherited []net.Listener
+	// endpoints tracks every Service registered against a given Endpoint so that Services sharing a
+	// bind address can be grouped and merged onto a single underlying transport server in Start
+	endpoints map[service.Endpoint][]service.Service
+	// listenerEndpoints remembers which Endpoint each Listener was created against so Start/Stop/Restart
+	// can look up the siblings a given Listener shares its socket with
+	listenerEndpoints map[uuid.UUID]service.Endpoint
+	// endpointRefs counts how many of an Endpoint's Listeners are currently started, so Stop only tears
+	// down the shared underlying server once its last Listener stops
+	endpointRefs map[service.Endpoint]int
 }
 
-// NewListenerService is a factory to create and return a ListenerService
-func NewListenerService() (ls ListenerService) {
-	ls.tcpRepo = WithTCPMemoryListenerRepository()
-	ls.httpRepo = WithHTTPMemoryListenerRepository()
-	ls.httpServerRepo = WithHTTPMemoryServerRepository()
-	return
+// Option configures a ListenerService as it is constructed, most commonly to select which backend
+// its Listener repositories persist to
+type Option func(*ListenerService) error
+
+// NewListenerService is a factory to create and return a ListenerService. It defaults every repository
+// to an in-memory backend, applies opts on top (letting callers swap in a persistent backend such as
+// WithTCPBoltListenerRepository), then inspects the LISTEN_FDS/LISTEN_PID environment variables for file
+// descriptors inherited from a graceful restart, and finally hydrates any Listener a persistent
+// repository already had on disk, auto-starting the ones whose stored AutoStart flag is true
+func NewListenerService(opts ...Option) (ls ListenerService, err error) {
+	ls.tcpRepo = tcpMemory.NewRepository()
+	ls.httpRepo = httpMemory.NewRepository()
+	ls.httpServerRepo = httpServerRepo.NewRepository()
+	ls.graceful = graceful.NewManager()
+	ls.endpoints = make(map[service.Endpoint][]service.Service)
+	ls.listenerEndpoints = make(map[uuid.UUID]service.Endpoint)
+	ls.endpointRefs = make(map[service.Endpoint]int)
+
+	for _, opt := range opts {
+		if err = opt(&ls); err != nil {
+			return ls, fmt.Errorf("pkg/services/listeners.NewListenerService(): %s", err)
+		}
+	}
+
+	inherited, err := graceful.InheritedListeners()
+	if err != nil {
+		// Fall back to fresh net.Listen calls; nothing was inherited to hand off
+		inherited = nil
+	}
+	ls.inherited = inherited
+	err = nil
+
+	if err = ls.hydrate(); err != nil {
+		return ls, fmt.Errorf("pkg/services/listeners.NewListenerService(): %s", err)
+	}
+	return ls, nil
+}
+
+// SetHammerTimeout sets how long a graceful Restart waits for in-flight Agent requests to finish on
+// the old Server before its listener is forcibly closed
+func (ls *ListenerService) SetHammerTimeout(d time.Duration) {
+	ls.graceful.SetHammerTimeout(d)
+}
+
+// WithTCPMemoryListenerRepository selects the default, non-persistent, in-memory TCP Listener repository
+func WithTCPMemoryListenerRepository() Option {
+	return func(ls *ListenerService) error {
+		ls.tcpRepo = tcpMemory.NewRepository()
+		return nil
+	}
+}
+
+// WithHTTPMemoryListenerRepository selects the default, non-persistent, in-memory HTTP Listener repository
+func WithHTTPMemoryListenerRepository() Option {
+	return func(ls *ListenerService) error {
+		ls.httpRepo = httpMemory.NewRepository()
+		return nil
+	}
+}
+
+// WithHTTPMemoryServerRepository selects the default, non-persistent, in-memory HTTP Server repository
+func WithHTTPMemoryServerRepository() Option {
+	return func(ls *ListenerService) error {
+		ls.httpServerRepo = httpServerRepo.NewRepository()
+		return nil
+	}
+}
+
+// WithTCPBoltListenerRepository selects a BoltDB-backed TCP Listener repository at the given file path,
+// so every TCP Listener's configuration survives a teamserver restart
+func WithTCPBoltListenerRepository(path string) Option {
+	return func(ls *ListenerService) error {
+		repo, err := tcpBolt.NewRepository(path)
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.WithTCPBoltListenerRepository(): %s", err)
+		}
+		ls.tcpRepo = repo
+		return nil
+	}
+}
+
+// WithHTTPBoltListenerRepository selects a BoltDB-backed HTTP Listener repository at the given file
+// path, so every HTTP Listener's configuration survives a teamserver restart
+func WithHTTPBoltListenerRepository(path string) Option {
+	return func(ls *ListenerService) error {
+		repo, err := httpBolt.NewRepository(path)
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.WithHTTPBoltListenerRepository(): %s", err)
+		}
+		ls.httpRepo = repo
+		return nil
+	}
+}
+
+// WithTCPSQLListenerRepository selects a database/sql-backed TCP Listener repository (e.g. SQLite), so
+// every TCP Listener's configuration survives a teamserver restart. Its queries use "?" placeholders, so
+// drivers that only accept numbered placeholders such as $1 (e.g. the Postgres drivers) are not supported
+func WithTCPSQLListenerRepository(driver, dataSourceName string) Option {
+	return func(ls *ListenerService) error {
+		repo, err := tcpSQL.NewRepository(driver, dataSourceName)
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.WithTCPSQLListenerRepository(): %s", err)
+		}
+		ls.tcpRepo = repo
+		return nil
+	}
+}
+
+// WithHTTPSQLListenerRepository selects a database/sql-backed HTTP Listener repository (e.g. SQLite), so
+// every HTTP Listener's configuration survives a teamserver restart. Its queries use "?" placeholders, so
+// drivers that only accept numbered placeholders such as $1 (e.g. the Postgres drivers) are not supported
+func WithHTTPSQLListenerRepository(driver, dataSourceName string) Option {
+	return func(ls *ListenerService) error {
+		repo, err := httpSQL.NewRepository(driver, dataSourceName)
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.WithHTTPSQLListenerRepository(): %s", err)
+		}
+		ls.httpRepo = repo
+		return nil
+	}
+}
+
+// hydrate reconstructs every Listener a persistent repository already had stored - run once, from
+// NewListenerService, before the ListenerService is handed back to the caller
+func (ls *ListenerService) hydrate() error {
+	if p, ok := ls.tcpRepo.(listeners.PersistentRepository); ok {
+		if err := p.Migrate(); err != nil {
+			return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+		}
+		records, err := p.Hydrate()
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+		}
+		for _, record := range records {
+			tListener, err := tcp.NewTCPListener(record.Options)
+			if err != nil {
+				return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+			}
+			if err = ls.tcpRepo.Add(tListener); err != nil {
+				return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+			}
+			ls.listenerEndpoints[tListener.ID()] = endpointFromOptions(record.Options)
+			if record.AutoStart {
+				if err = ls.Start(tListener.ID()); err != nil {
+					return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+				}
+			}
+		}
+	}
+
+	if p, ok := ls.httpRepo.(listeners.PersistentRepository); ok {
+		if err := p.Migrate(); err != nil {
+			return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+		}
+		records, err := p.Hydrate()
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+		}
+		for _, record := range records {
+			hServer, err := httpServer.New(record.Options)
+			if err != nil {
+				return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+			}
+			ep := endpointFromOptions(record.Options)
+			// If a prior process handed this socket off via ReExec, resume serving on it instead of
+			// letting the fresh Server bind a new one
+			if inherited := ls.takeInheritedListener(ep); inherited != nil {
+				hServer.SetListener(inherited)
+			}
+			if err = ls.httpServerRepo.Add(hServer); err != nil {
+				return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+			}
+			hListener, err := http.NewHTTPListener(&hServer, record.Options)
+			if err != nil {
+				return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+			}
+			if err = ls.httpRepo.Add(hListener); err != nil {
+				return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+			}
+			ls.listenerEndpoints[hListener.ID()] = ep
+			if record.AutoStart {
+				if err = ls.Start(hListener.ID()); err != nil {
+					return fmt.Errorf("pkg/services/listeners.hydrate(): %s", err)
+				}
+			}
+		}
+	}
+
+	// Anything left over was inherited from a prior process but no longer matches a persisted Listener;
+	// close it rather than leaking the file descriptor
+	for _, l := range ls.inherited {
+		_ = l.Close()
+	}
+	ls.inherited = nil
+	return nil
+}
+
+// takeInheritedListener removes and returns the first inherited net.Listener whose bind address matches
+// ep, so hydrate can resume serving on the same socket a prior process handed off via ReExec instead of
+// rebinding. It returns nil if no inherited listener matches
+func (ls *ListenerService) takeInheritedListener(ep service.Endpoint) net.Listener {
+	for i, l := range ls.inherited {
+		if l.Addr().String() == ep.Address {
+			ls.inherited = append(ls.inherited[:i], ls.inherited[i+1:]...)
+			return l
+		}
+	}
+	return nil
+}
+
+// persist write-throughs a freshly created or updated Listener's configuration to its repository, if
+// that repository is a PersistentRepository; it is a no-op against the default in-memory repositories
+func (ls *ListenerService) persist(protocol string, id uuid.UUID, name string, options map[string]string) error {
+	autoStart := strings.EqualFold(options["AutoStart"], "true")
+	var repo interface{}
+	switch strings.ToLower(protocol) {
+	case "tcp":
+		repo = ls.tcpRepo
+	default:
+		repo = ls.httpRepo
+	}
+	if p, ok := repo.(listeners.PersistentRepository); ok {
+		if err := p.Persist(id, name, protocol, options, autoStart); err != nil {
+			return fmt.Errorf("pkg/services/listeners.persist(): %s", err)
+		}
+	}
+	return nil
+}
+
+// endpointFromOptions derives the Endpoint a Listener will bind to from its options map
+func endpointFromOptions(options map[string]string) service.Endpoint {
+	return service.Endpoint{
+		Protocol: strings.ToLower(options["Protocol"]),
+		Address:  fmt.Sprintf("%s:%s", options["Interface"], options["Port"]),
+	}
+}
+
+// registerServices records the passed in Services against ep, refusing duplicate Service names on the
+// same Endpoint. The actual merge is deferred to Start, at which point every Listener bound to ep is
+// known and a conflicting, unmergeable pair can be reported before anything is bound
+func (ls *ListenerService) registerServices(ep service.Endpoint, services []service.Service) error {
+	for i, s := range services {
+		for _, existing := range ls.endpoints[ep] {
+			if existing.Name() == s.Name() {
+				return fmt.Errorf("pkg/services/listeners.registerServices(): service %q is already registered on endpoint %s", s.Name(), ep)
+			}
+		}
+		for _, earlier := range services[:i] {
+			if earlier.Name() == s.Name() {
+				return fmt.Errorf("pkg/services/listeners.registerServices(): service %q is listed more than once for endpoint %s", s.Name(), ep)
+			}
+		}
+	}
+	ls.endpoints[ep] = append(ls.endpoints[ep], services...)
+	return nil
 }
 
-// WithTCPMemoryListenerRepository retrieves an in-memory TCP Listener repository interface used to manage Listener objects
-func WithTCPMemoryListenerRepository() tcp.Repository {
-	return tcpMemory.NewRepository()
+// mergedService folds every Service registered against ep into a single Service, returning an error if
+// more than one Service is registered and any pair of them does not implement service.Merger, or if any
+// pair of them terminates TLS with a different configuration
+func (ls *ListenerService) mergedService(ep service.Endpoint) (service.Service, error) {
+	registered := ls.endpoints[ep]
+	if len(registered) == 0 {
+		return nil, nil
+	}
+	if err := tlsConfigsAgree(registered); err != nil {
+		return nil, fmt.Errorf("pkg/services/listeners.mergedService(): endpoint %s: %s", ep, err)
+	}
+	merged := registered[0]
+	for _, s := range registered[1:] {
+		merger, ok := merged.(service.Merger)
+		if !ok {
+			return nil, fmt.Errorf("pkg/services/listeners.mergedService(): endpoint %s has multiple services but %q does not implement service.Merger", ep, merged.Name())
+		}
+		var err error
+		merged, err = merger.Merge(s)
+		if err != nil {
+			return nil, fmt.Errorf("pkg/services/listeners.mergedService(): %s", err)
+		}
+	}
+	return merged, nil
 }
 
-// WithHTTPMemoryListenerRepository retrieves an in-memory HTTP Listener repository interface used to manage Listener objects
-func WithHTTPMemoryListenerRepository() http.Repository {
-	return httpMemory.NewRepository()
+// tlsConfigsAgree returns an error if any two of the passed in Services that implement
+// service.TLSTerminator report different TLS configurations, so two Services can't be silently combined
+// onto a shared socket with incompatible certificates or minimum versions
+func tlsConfigsAgree(services []service.Service) error {
+	var first service.TLSTerminator
+	for _, s := range services {
+		terminator, ok := s.(service.TLSTerminator)
+		if !ok {
+			continue
+		}
+		if first == nil {
+			first = terminator
+			continue
+		}
+		if !tlsConfigEqual(first.TLS(), terminator.TLS()) {
+			return fmt.Errorf("service %q and %q disagree on TLS config", first.Name(), terminator.Name())
+		}
+	}
+	return nil
 }
 
-// WithHTTPMemoryServerRepository retrieves an in-memory HTTP Server repository interface used to manage Server objects
-func WithHTTPMemoryServerRepository() httpServer.Repository {
-	return httpServerRepo.NewRepository()
+// tlsConfigEqual reports whether two TLS configs are interchangeable for the purpose of sharing a single
+// listening socket. tls.Config cannot be compared with == since it embeds a sync.Mutex, so the fields
+// that actually affect the handshake are compared explicitly instead
+func tlsConfigEqual(a, b *tls.Config) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.MinVersion != b.MinVersion || len(a.Certificates) != len(b.Certificates) {
+		return false
+	}
+	for i := range a.Certificates {
+		if !bytes.Equal(a.Certificates[i].Certificate[0], b.Certificates[i].Certificate[0]) {
+			return false
+		}
+	}
+	return true
 }
 
-// NewListener is a factory that takes in a map of options used to configure a Listener, adds the Listener to its
-// respective repository, and returns a copy created Listener object
-func (ls *ListenerService) NewListener(options map[string]string) (listener listeners.Listener, er error) {
+// NewListener is a factory that takes in a map of options used to configure a Listener plus the
+// Services (e.g. an Agent handler, and optionally an admin API and/or a Prometheus metrics exporter)
+// that should be reachable on it, adds the Listener to its respective repository, and returns a copy of
+// the created Listener object. Services are grouped by Endpoint and merged lazily in Start
+func (ls *ListenerService) NewListener(options map[string]string, services []service.Service) (listener listeners.Listener, er error) {
 	// Determine the infrastructure layer server
 	if _, ok := options["Protocol"]; !ok {
 		return nil, fmt.Errorf("pkg/services/listeners.CreateListener(): the options map did not contain the \"Protocol\" key")
 	}
 
+	ep := endpointFromOptions(options)
+	if err := ls.registerServices(ep, services); err != nil {
+		return nil, fmt.Errorf("pkg/services/listeners.CreateListener(): %s", err)
+	}
+
 	switch strings.ToLower(options["Protocol"]) {
 	//case servers.HTTP, servers.HTTPS, servers.H2C, servers.HTTP2, servers.HTTP3:
 	case "http", "https", "h2c", "http2", "http3":
@@ -98,7 +428,6 @@ func (ls *ListenerService) NewListener(options map[string]string) (listener list
 			return nil, fmt.Errorf("pkg/services/listeners.CreateListener(): %s", err)
 		}
 		listener = &hListener
-		return
 	case "tcp":
 		// Create a new TCP Listener
 		tListener, err := tcp.NewTCPListener(options)
@@ -111,10 +440,14 @@ func (ls *ListenerService) NewListener(options map[string]string) (listener list
 			return nil, fmt.Errorf("pkg/services/listeners.CreateListener(): %s", err)
 		}
 		listener = &tListener
-		return
 	default:
 		return nil, fmt.Errorf("pkg/services/listeners.CreateListener(): unhandled server type %d", servers.FromString(options["Protocol"]))
 	}
+	ls.listenerEndpoints[listener.ID()] = ep
+	if err := ls.persist(options["Protocol"], listener.ID(), listener.Name(), options); err != nil {
+		return nil, fmt.Errorf("pkg/services/listeners.CreateListener(): %s", err)
+	}
+	return
 }
 
 // CLICompleter returns a list of Listener & Server types that Merlin supports for CLI tab completion
@@ -260,76 +593,213 @@ func (ls *ListenerService) Remove(id uuid.UUID) error {
 		return err
 	}
 
+	ls.graceful.Unregister(id)
+
+	ep, ok := ls.listenerEndpoints[id]
+	if ok {
+		delete(ls.listenerEndpoints, id)
+		shared := false
+		for _, other := range ls.listenerEndpoints {
+			if other == ep {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			delete(ls.endpoints, ep)
+			delete(ls.endpointRefs, ep)
+		}
+	}
+
+	var repo interface{ RemoveByID(uuid.UUID) error }
 	switch listener.Protocol() {
 	case listeners.HTTP:
-		return ls.httpRepo.RemoveByID(id)
+		repo = ls.httpRepo
 	case listeners.TCP:
-		return ls.tcpRepo.RemoveByID(id)
+		repo = ls.tcpRepo
 	default:
 		return fmt.Errorf("pkg/services/listeners.Remove(): unhandled listener protocol type %d for listener %s", listener.Protocol(), id)
 	}
+	if err := repo.RemoveByID(id); err != nil {
+		return err
+	}
+	if p, ok := repo.(listeners.PersistentRepository); ok {
+		if err := p.Forget(id); err != nil {
+			return fmt.Errorf("pkg/services/listeners.Remove(): %s", err)
+		}
+	}
+	return nil
 }
 
-// Restart terminates a Listener's embedded Server object (if applicable) and then starts it again
-func (ls *ListenerService) Restart(id uuid.UUID) error {
+// Restart terminates a Listener's embedded Server object (if applicable) and then starts it again. Like
+// Stop, it operates at the endpoint level: if the Listener shares its Endpoint with a sibling Service
+// that is still started, Restart is a no-op rather than tearing down the socket out from under the
+// sibling. When graceful is true, the whole process is handed off via the graceful package - every
+// tracked listener file descriptor, across every Endpoint, is passed to a freshly re-exec'd copy of this
+// binary, which resumes serving on the same sockets through InheritedListeners/hydrate instead of
+// dropping connections during a rebind; when false, it falls back to the old Stop-then-Start behavior
+func (ls *ListenerService) Restart(id uuid.UUID, graceful bool) error {
 	// Get the listener
 	listener, err := ls.Listener(id)
 	if err != nil {
 		return fmt.Errorf("pkg/services/listeners.Restart(): %s", err)
 	}
+
+	ep := ls.listenerEndpoints[id]
+	if ls.endpointRefs[ep] > 1 {
+		return nil
+	}
+
 	server := *listener.Server()
-	err = server.Stop()
-	if err != nil {
+
+	if !graceful {
+		err = server.Stop()
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.Restart(): %s", err)
+		}
+		go server.Start()
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ls.graceful.HammerTimeout())
+	defer cancel()
+
+	// Drain before handing off: Shutdown stops the Server's Accept loop and waits up to the hammer
+	// timeout for in-flight Agent requests to finish, but the listening socket itself stays open because
+	// graceful.Register retained its own dup'd descriptor - any new connection just queues in the kernel
+	// accept backlog until the re-exec'd process below resumes Accept()'ing on the inherited fd, so
+	// nothing is dropped
+	if err = server.Shutdown(ctx); err != nil {
 		return fmt.Errorf("pkg/services/listeners.Restart(): %s", err)
 	}
-	go server.Start()
+
+	// ReExec replaces this process image outright and, on success, never returns to this line. If it
+	// fails - e.g. the binary can't be located - the Server was already drained above, so fall back to
+	// starting it fresh rather than leaving the Listener down
+	if err = ls.graceful.ReExec(); err != nil {
+		go server.Start()
+		return fmt.Errorf("pkg/services/listeners.Restart(): graceful re-exec failed after draining, restarted fresh: %s", err)
+	}
 	return nil
 }
 
-// SetOptions replaces an existing Listener's configurable options map with the one provided
+// SetOptions replaces an existing Listener's configurable options map with the one provided. If the new
+// options move the Listener to a different Endpoint (e.g. a changed Port, Interface, or Protocol), its
+// entry in listenerEndpoints/endpoints/endpointRefs is re-keyed to follow it, so Start/Stop/Restart keep
+// managing it under the right Endpoint instead of the stale one. The move is refused if the Listener
+// currently shares its Endpoint with another Listener, since there's no way to tell which of the
+// Endpoint's merged Services belong to just this one
 func (ls *ListenerService) SetOptions(id uuid.UUID, options map[string]string) error {
 	listener, err := ls.Listener(id)
 	if err != nil {
 		return err
 	}
+
+	oldEp, hadEp := ls.listenerEndpoints[id]
+	newEp := endpointFromOptions(options)
+	moving := hadEp && newEp != oldEp
+	if moving {
+		for otherID, ep := range ls.listenerEndpoints {
+			if otherID != id && ep == oldEp {
+				return fmt.Errorf("pkg/services/listeners.SetOptions(): listener %s shares endpoint %s with another listener, refusing to move it to %s", id, oldEp, newEp)
+			}
+		}
+	}
+
+	var protocol string
 	switch listener.Protocol() {
 	case listeners.HTTP:
-		return ls.httpRepo.UpdateOptions(id, options)
+		protocol = "http"
+		err = ls.httpRepo.UpdateOptions(id, options)
 	case listeners.TCP:
-		return ls.tcpRepo.UpdateOptions(id, options)
+		protocol = "tcp"
+		err = ls.tcpRepo.UpdateOptions(id, options)
 	default:
 		return fmt.Errorf("pkg/services/listeners.SetOptions(): unhandled protocol %d for listener %s", listener.Protocol(), id)
 	}
+	if err != nil {
+		return err
+	}
+
+	if moving {
+		ls.listenerEndpoints[id] = newEp
+		ls.endpoints[newEp] = append(ls.endpoints[newEp], ls.endpoints[oldEp]...)
+		delete(ls.endpoints, oldEp)
+		ls.endpointRefs[newEp] += ls.endpointRefs[oldEp]
+		delete(ls.endpointRefs, oldEp)
+	}
+
+	return ls.persist(protocol, id, listener.Name(), options)
 }
 
-// Start initiates the Listener's embedded Server object (if applicable) to start listening and responding to Agent communications
+// Start initiates the Listener's embedded Server object (if applicable) to start listening and
+// responding to Agent communications. Because more than one Listener's Services can share a single
+// bind address, the underlying Server is only actually started once for the Endpoint; additional
+// Listeners at that Endpoint just bump its reference count
 func (ls *ListenerService) Start(id uuid.UUID) error {
 	// Get the listener
 	listener, err := ls.Listener(id)
 	if err != nil {
 		return fmt.Errorf("pkg/services/listeners.Start(): %s", err)
 	}
+	ep := ls.listenerEndpoints[id]
 	switch listener.Protocol() {
 	case listeners.HTTP:
+		// Re-merge and re-install the handler on every call, not just the one that actually starts the
+		// transport server: a sibling Service (e.g. an admin API or metrics exporter) can be registered
+		// via NewListener against an Endpoint that's already live, and without this it would silently
+		// never get wired into the running Server's handler
+		merged, err := ls.mergedService(ep)
+		if err != nil {
+			return fmt.Errorf("pkg/services/listeners.Start(): %s", err)
+		}
 		server := *listener.Server()
-		// Start() does not return until the transport server is killed and therefore must be run in a go routine
-		go server.Start()
+		if merged != nil {
+			handler, ok := merged.(service.HandlerProvider)
+			if !ok {
+				return fmt.Errorf("pkg/services/listeners.Start(): service %q registered on endpoint %s does not implement service.HandlerProvider", merged.Name(), ep)
+			}
+			server.SetHandler(handler.Handler())
+		}
+		if ls.endpointRefs[ep] == 0 {
+			if l := server.Listener(); l != nil {
+				if err = ls.graceful.Register(id, l); err != nil {
+					return fmt.Errorf("pkg/services/listeners.Start(): %s", err)
+				}
+			}
+			// Start() does not return until the transport server is killed and therefore must be run in a go routine
+			go server.Start()
+		}
+		ls.endpointRefs[ep]++
 		return nil
 	case listeners.TCP:
 		// Nothing to do, there is not an infrastructure layer server to start for the TCP listener
+		ls.endpointRefs[ep]++
 		return nil
 	default:
 		return fmt.Errorf("pkg/services/listeners.Start(): unhandled listener protocol: %d", listener.Protocol())
 	}
 }
 
-// Stop terminates the Listener's embedded Server object (if applicable) to stop it listening for incoming Agent messages
+// Stop terminates the Listener's embedded Server object (if applicable) to stop it listening for
+// incoming Agent messages. If the Listener shares its Endpoint with a sibling Service that is still
+// started, the underlying Server keeps running and only the reference count is decremented
 func (ls *ListenerService) Stop(id uuid.UUID) error {
 	// Get the listener
 	listener, err := ls.Listener(id)
 	if err != nil {
-		return fmt.Errorf("pkg/services/listeners.Restart(): %s", err)
+		return fmt.Errorf("pkg/services/listeners.Stop(): %s", err)
+	}
+	ep := ls.listenerEndpoints[id]
+	if ls.endpointRefs[ep] > 1 {
+		ls.endpointRefs[ep]--
+		return nil
 	}
 	server := *listener.Server()
-	return server.Stop()
+	err = server.Stop()
+	if err != nil {
+		return fmt.Errorf("pkg/services/listeners.Stop(): %s", err)
+	}
+	delete(ls.endpointRefs, ep)
+	return nil
 }
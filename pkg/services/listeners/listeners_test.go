@@ -0,0 +1,179 @@
+// Merlin is a post-exploitation command and control framework.
+// This file is part of Merlin.
+// Copyright (C) 2022  Russel Van Tuyl
+
+// Merlin is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// any later version.
+
+// Merlin is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with Merlin.  If not, see <http://www.gnu.org/licenses/>.
+
+package listeners
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/Ne0nd0g/merlin/pkg/service"
+)
+
+// stubService is a minimal service.Service used to exercise mergedService/tlsConfigsAgree without
+// pulling in a real Agent handler or HTTP server
+type stubService struct {
+	name string
+}
+
+func (s stubService) Name() string                  { return s.name }
+func (s stubService) Endpoints() []service.Endpoint { return nil }
+
+// stubMerger additionally implements service.Merger by always returning itself, so chains of more than
+// two stub services can be folded without asserting anything about the merge result's identity
+type stubMerger struct {
+	stubService
+}
+
+func (s stubMerger) Merge(service.Service) (service.Service, error) { return s, nil }
+
+// stubTLS additionally implements service.TLSTerminator so tlsConfigsAgree has something to compare
+type stubTLS struct {
+	stubMerger
+	tlsConfig *tls.Config
+}
+
+func (s stubTLS) TLS() *tls.Config { return s.tlsConfig }
+
+func certWithRaw(raw byte) tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{{raw}}}
+}
+
+func TestTlsConfigEqual(t *testing.T) {
+	certA := certWithRaw(0x01)
+	certB := certWithRaw(0x02)
+
+	tests := []struct {
+		name string
+		a    *tls.Config
+		b    *tls.Config
+		want bool
+	}{
+		{name: "both nil", a: nil, b: nil, want: true},
+		{name: "one nil", a: &tls.Config{}, b: nil, want: false},
+		{name: "equal empty configs", a: &tls.Config{}, b: &tls.Config{}, want: true},
+		{
+			name: "different min version",
+			a:    &tls.Config{MinVersion: tls.VersionTLS12},
+			b:    &tls.Config{MinVersion: tls.VersionTLS13},
+			want: false,
+		},
+		{
+			name: "different certificate count",
+			a:    &tls.Config{Certificates: []tls.Certificate{certA}},
+			b:    &tls.Config{},
+			want: false,
+		},
+		{
+			name: "different certificate bytes",
+			a:    &tls.Config{Certificates: []tls.Certificate{certA}},
+			b:    &tls.Config{Certificates: []tls.Certificate{certB}},
+			want: false,
+		},
+		{
+			name: "same certificate bytes",
+			a:    &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{certA}},
+			b:    &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{certA}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tlsConfigEqual(tt.a, tt.b); got != tt.want {
+				t.Errorf("tlsConfigEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTlsConfigsAgree(t *testing.T) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	agree := []service.Service{
+		stubTLS{stubMerger{stubService{name: "a"}}, cfg},
+		stubTLS{stubMerger{stubService{name: "b"}}, cfg},
+	}
+	if err := tlsConfigsAgree(agree); err != nil {
+		t.Errorf("tlsConfigsAgree() returned an error for identical configs: %s", err)
+	}
+
+	disagree := []service.Service{
+		stubTLS{stubMerger{stubService{name: "a"}}, &tls.Config{MinVersion: tls.VersionTLS12}},
+		stubTLS{stubMerger{stubService{name: "b"}}, &tls.Config{MinVersion: tls.VersionTLS13}},
+	}
+	if err := tlsConfigsAgree(disagree); err == nil {
+		t.Error("tlsConfigsAgree() did not return an error for conflicting configs")
+	}
+}
+
+func TestMergedService(t *testing.T) {
+	ep := service.Endpoint{Protocol: "http", Address: "127.0.0.1:8080"}
+
+	t.Run("no services", func(t *testing.T) {
+		ls := ListenerService{endpoints: map[service.Endpoint][]service.Service{}}
+		merged, err := ls.mergedService(ep)
+		if err != nil {
+			t.Fatalf("mergedService() returned an unexpected error: %s", err)
+		}
+		if merged != nil {
+			t.Errorf("mergedService() = %v, want nil", merged)
+		}
+	})
+
+	t.Run("single service is returned as-is", func(t *testing.T) {
+		svc := stubService{name: "agent"}
+		ls := ListenerService{endpoints: map[service.Endpoint][]service.Service{ep: {svc}}}
+		merged, err := ls.mergedService(ep)
+		if err != nil {
+			t.Fatalf("mergedService() returned an unexpected error: %s", err)
+		}
+		if merged.Name() != "agent" {
+			t.Errorf("mergedService() = %q, want %q", merged.Name(), "agent")
+		}
+	})
+
+	t.Run("non-merger services conflict", func(t *testing.T) {
+		ls := ListenerService{endpoints: map[service.Endpoint][]service.Service{
+			ep: {stubService{name: "agent"}, stubService{name: "admin"}},
+		}}
+		if _, err := ls.mergedService(ep); err == nil {
+			t.Error("mergedService() did not return an error for services that don't implement service.Merger")
+		}
+	})
+
+	t.Run("disagreeing TLS configs conflict", func(t *testing.T) {
+		ls := ListenerService{endpoints: map[service.Endpoint][]service.Service{
+			ep: {
+				stubTLS{stubMerger{stubService{name: "agent"}}, &tls.Config{MinVersion: tls.VersionTLS12}},
+				stubTLS{stubMerger{stubService{name: "admin"}}, &tls.Config{MinVersion: tls.VersionTLS13}},
+			},
+		}}
+		if _, err := ls.mergedService(ep); err == nil {
+			t.Error("mergedService() did not return an error for services with conflicting TLS configs")
+		}
+	})
+
+	t.Run("mergers combine", func(t *testing.T) {
+		ls := ListenerService{endpoints: map[service.Endpoint][]service.Service{
+			ep: {stubMerger{stubService{name: "agent"}}, stubMerger{stubService{name: "admin"}}},
+		}}
+		if _, err := ls.mergedService(ep); err != nil {
+			t.Errorf("mergedService() returned an unexpected error: %s", err)
+		}
+	})
+}